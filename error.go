@@ -0,0 +1,92 @@
+package pongo2
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Location pinpoints a single position in a template's source: the file it
+// came from, its 1-based line/column, and the raw byte offset of that
+// position within the source.
+type Location struct {
+	Filename string
+	Line     int
+	Column   int
+	Offset   int
+}
+
+func (loc Location) String() string {
+	return fmt.Sprintf("%s Line %d Col %d", loc.Filename, loc.Line, loc.Column)
+}
+
+// Error is returned by the lexer, parser and template execution whenever
+// something goes wrong while processing a template. Sender identifies which
+// stage raised it ("lexer", "parser" or "execution") and Token, if non-nil,
+// is the token that triggered it, so IDE tooling can consume a structured
+// error instead of scraping the formatted message.
+type Error struct {
+	Sender   string
+	Location Location
+	Token    *Token
+	Msg      string
+
+	// source is the full template the error occurred in. It's kept around
+	// (rather than just the offending line) so Error() can slice out the
+	// excerpt and render a caret underneath it on demand.
+	source string
+}
+
+// Error implements the error interface, rendering a message of the form:
+//
+//	[Lexer Error in tpl.html Line 1 Col 8]: Unknown character: '@' (64)
+//	    {{ user@name }}
+//	           ^
+func (e *Error) Error() string {
+	sender := e.Sender
+	if sender != "" {
+		sender = strings.ToUpper(sender[:1]) + sender[1:]
+	}
+	head := fmt.Sprintf("[%s Error in %s Line %d Col %d]: %s",
+		sender, e.Location.Filename, e.Location.Line, e.Location.Column, e.Msg)
+
+	excerpt, caret := e.excerpt()
+	if excerpt == "" {
+		return head
+	}
+	return fmt.Sprintf("%s\n    %s\n    %s", head, excerpt, caret)
+}
+
+// excerpt slices the failing line back out of e.source and builds a caret
+// string to print underneath it. Tabs in the source line are mirrored as
+// tabs in the caret line (spaces as spaces), so the caret still lines up
+// once a terminal expands the tabs.
+func (e *Error) excerpt() (line string, caret string) {
+	if e.source == "" || e.Location.Line <= 0 {
+		return "", ""
+	}
+
+	lines := strings.Split(e.source, "\n")
+	if e.Location.Line > len(lines) {
+		return "", ""
+	}
+	line = lines[e.Location.Line-1]
+
+	col := e.Location.Column
+	if col < 1 {
+		col = 1
+	}
+	if col > len(line)+1 {
+		col = len(line) + 1
+	}
+
+	caretBytes := make([]byte, 0, col)
+	for i := 0; i < col-1; i++ {
+		if i < len(line) && line[i] == '\t' {
+			caretBytes = append(caretBytes, '\t')
+		} else {
+			caretBytes = append(caretBytes, ' ')
+		}
+	}
+	caretBytes = append(caretBytes, '^')
+	return line, string(caretBytes)
+}
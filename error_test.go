@@ -0,0 +1,85 @@
+package pongo2
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestErrorRendersExcerptAndCaret(t *testing.T) {
+	src := "{{ user@name }}"
+	_, err := lex("tpl.html", src, nil)
+	if err == nil {
+		t.Fatalf("expected a lexer error for '@'")
+	}
+
+	perr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("err is %T, want *Error", err)
+	}
+	if perr.Sender != "lexer" {
+		t.Errorf("Sender = %q, want %q", perr.Sender, "lexer")
+	}
+	if perr.Location.Filename != "tpl.html" {
+		t.Errorf("Location.Filename = %q, want %q", perr.Location.Filename, "tpl.html")
+	}
+	if perr.Location.Line != 1 || perr.Location.Column != 8 {
+		t.Errorf("Location = Line %d Col %d, want Line 1 Col 8", perr.Location.Line, perr.Location.Column)
+	}
+	if perr.Token == nil || perr.Token.Typ != TokenError {
+		t.Fatalf("Token = %+v, want a TokenError token", perr.Token)
+	}
+
+	want := "[Lexer Error in tpl.html Line 1 Col 8]: Unknown character: '@' (64)\n" +
+		"    {{ user@name }}\n" +
+		"           ^"
+	if got := perr.Error(); got != want {
+		t.Errorf("Error() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestErrorCaretIsTabAware(t *testing.T) {
+	// A tab before the tag is mirrored as a tab in the caret line, so the
+	// caret still lines up once a terminal expands it - counting it as a
+	// single column (like a space) would misalign the caret.
+	src := "\t{{ @ }}"
+	_, err := lex("tpl.html", src, nil)
+	if err == nil {
+		t.Fatalf("expected a lexer error for '@'")
+	}
+	perr := err.(*Error)
+
+	want := "[Lexer Error in tpl.html Line 1 Col 5]: Unknown character: '@' (64)\n" +
+		"    \t{{ @ }}\n" +
+		"    \t   ^"
+	if got := perr.Error(); got != want {
+		t.Errorf("Error() =\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestErrorColumnAccountsForLeadingIntraTagWhitespace(t *testing.T) {
+	// A regression test for a stale startcol: lex() used to report an
+	// offending character's column as if the whitespace preceding it
+	// inside the tag hadn't been skipped at all, because ignore() (used
+	// to drop that whitespace) didn't resync startcol/startline to the
+	// current col/line the way emit() does.
+	_, err := lex("tpl.html", "{{   @ }}", nil)
+	if err == nil {
+		t.Fatalf("expected a lexer error for '@'")
+	}
+	perr := err.(*Error)
+	if perr.Location.Column != 6 {
+		t.Errorf("Location.Column = %d, want 6", perr.Location.Column)
+	}
+}
+
+func TestErrorWithoutSourceHasNoExcerpt(t *testing.T) {
+	e := &Error{
+		Sender:   "lexer",
+		Location: Location{Filename: "tpl.html", Line: 1, Column: 1},
+		Msg:      "boom",
+	}
+	msg := e.Error()
+	if strings.Contains(msg, "\n") {
+		t.Errorf("Error() = %q, want a single line when there's no source to excerpt", msg)
+	}
+}
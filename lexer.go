@@ -1,8 +1,9 @@
 package pongo2
 
 import (
-	"errors"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
 	"unicode/utf8"
 )
@@ -24,13 +25,14 @@ var (
 	tokenSpaceChars      = " \n\r\t"
 	tokenIdentifierChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_"
 	tokenDigits          = "0123456789"
-	tokenSymbols         = []string{
-		// 3-Char symbols
 
-		// 2-Char symbols
-		"==", ">=", "<=", "&&", "||", "{{", "}}", "{%", "%}", "!=", "<>",
-
-		// 1-Char symbol
+	// operatorSymbols are the symbols recognized inside a tag/variable
+	// that aren't delimiters. Delimiter symbols (variable/block start &
+	// end, plus their hyphenated whitespace-control variants) are
+	// computed per-lexer from Delimiters instead, since they're
+	// configurable; see buildTokenSymbols.
+	operatorSymbols = []string{
+		"==", ">=", "<=", "&&", "||", "!=", "<>",
 		"(", ")", "+", "-", "*", "<", ">", "/", "^", ",", ".", "!", "|", ":", "=",
 	}
 	tokenKeywords = []string{"in", "and", "or", "not", "true", "false"}
@@ -38,25 +40,204 @@ var (
 
 type TokenType int
 type Token struct {
-	Typ  TokenType
-	Val  string
-	Line int
-	Col  int
+	Typ    TokenType
+	Val    string
+	Raw    string // original source text, before escape decoding; same as Val for non-string tokens
+	Line   int
+	Col    int
+	Offset int // byte offset of the token's first rune within the source
+}
+
+// Delimiters configures the character sequences that mark the start/end of
+// variable, block and comment sections. Swap them out when the defaults
+// (`{{ }}`, `{% %}`, `{# #}`) clash with a template's target syntax (LaTeX,
+// Vue/Angular templates, shell here-docs, ...).
+type Delimiters struct {
+	VariableStart string
+	VariableEnd   string
+	BlockStart    string
+	BlockEnd      string
+	CommentStart  string
+	CommentEnd    string
+}
+
+// DefaultDelimiters are the delimiters pongo2 uses when Options doesn't
+// configure its own.
+var DefaultDelimiters = Delimiters{
+	VariableStart: "{{", VariableEnd: "}}",
+	BlockStart: "{%", BlockEnd: "%}",
+	CommentStart: "{#", CommentEnd: "#}",
+}
+
+func (d Delimiters) isZero() bool {
+	return d == Delimiters{}
+}
+
+type namedDelimiter struct {
+	name string
+	val  string
+}
+
+func (d Delimiters) all() []namedDelimiter {
+	return []namedDelimiter{
+		{"VariableStart", d.VariableStart}, {"VariableEnd", d.VariableEnd},
+		{"BlockStart", d.BlockStart}, {"BlockEnd", d.BlockEnd},
+		{"CommentStart", d.CommentStart}, {"CommentEnd", d.CommentEnd},
+	}
+}
+
+// validate ensures no delimiter is empty or a prefix of another delimiter
+// (run()'s detection of which section - comment, block or variable - starts
+// at the current position relies on checking them in a fixed order, so one
+// shadowing another would silently misroute). Variable/block delimiters are
+// additionally checked for being exactly equal to an operator symbol, since
+// those two share the same stateCode symbol scan and an exact match would be
+// genuinely ambiguous; comment delimiters never reach that scan, so they're
+// exempt. A delimiter merely sharing a prefix with a shorter operator (e.g.
+// "<%" vs "<") is fine: buildTokenSymbols sorts symbols longest-first, so
+// the scan always prefers the delimiter over the shorter operator.
+func (d Delimiters) validate() error {
+	all := d.all()
+	for _, n := range all {
+		if n.val == "" {
+			return fmt.Errorf("pongo2: delimiter %s must not be empty", n.name)
+		}
+	}
+	for i, a := range all {
+		for j, b := range all {
+			if i == j {
+				continue
+			}
+			if strings.HasPrefix(a.val, b.val) || strings.HasPrefix(b.val, a.val) {
+				return fmt.Errorf("pongo2: delimiter %s (%q) conflicts with %s (%q): one is a prefix of the other",
+					a.name, a.val, b.name, b.val)
+			}
+		}
+	}
+
+	tagDelims := []namedDelimiter{
+		{"VariableStart", d.VariableStart}, {"VariableEnd", d.VariableEnd},
+		{"BlockStart", d.BlockStart}, {"BlockEnd", d.BlockEnd},
+	}
+	for _, a := range tagDelims {
+		for _, op := range operatorSymbols {
+			if a.val == op {
+				return fmt.Errorf("pongo2: delimiter %s (%q) collides with operator symbol %q", a.name, a.val, op)
+			}
+		}
+	}
+	return nil
+}
+
+// buildTokenSymbols assembles the symbol table stateCode scans against:
+// the configured delimiters (plus their hyphenated whitespace-control
+// variants) and the fixed operator symbols, longest first so the
+// prefix-matching scan in stateCode always prefers the longest symbol.
+func buildTokenSymbols(delims Delimiters) []string {
+	syms := []string{
+		delims.VariableStart + "-", "-" + delims.VariableEnd,
+		delims.BlockStart + "-", "-" + delims.BlockEnd,
+		delims.VariableStart, delims.VariableEnd,
+		delims.BlockStart, delims.BlockEnd,
+	}
+	syms = append(syms, operatorSymbols...)
+	sort.SliceStable(syms, func(i, j int) bool { return len(syms[i]) > len(syms[j]) })
+	return syms
+}
+
+// Options controls lexer behavior a template can opt into. It mirrors the
+// subset of Jinja2's global whitespace-control toggles this lexer
+// understands, plus the configurable Delimiters; a future TemplateSet is
+// expected to expose these as TemplateSet.Options.
+type Options struct {
+	// TrimBlocks removes the first newline after a block tag's closing
+	// %}, without requiring an explicit `-%}` on every tag.
+	TrimBlocks bool
+
+	// LStripBlocks strips whitespace between the start of a line and a
+	// block tag's opening {%, when that whitespace is the only thing
+	// preceding it on the line.
+	LStripBlocks bool
+
+	// Delimiters overrides the default {{ }} / {% %} / {# #} delimiters.
+	// The zero value means "use DefaultDelimiters".
+	Delimiters Delimiters
 }
 
 type lexerStateFn func() lexerStateFn
 type lexer struct {
-	name      string
-	input     string
-	start     int // start pos of the item
-	pos       int // current pos
-	width     int // width of last rune
-	tokens    []*Token
-	errored   bool
+	name    string
+	input   string
+	opts    *Options
+	delims  Delimiters
+	symbols []string
+	start   int // start pos of the item
+	pos     int // current pos
+	width   int // width of last rune
+	tokens  []*Token
+	errored bool
+
+	// reader, when non-nil (LexReader), is pulled from on demand to grow
+	// input as next()/hasPrefixAt() need more lookahead than is currently
+	// buffered, instead of requiring the whole template up front.
+	reader  io.RuneReader
+	readEOF bool
+
+	// out/sent implement the channel form of token delivery for
+	// LexReader: out is the channel tokens are forwarded to, and sent is
+	// how many of l.tokens have been forwarded already. Forwarding is
+	// deferred to flush(), called between iterations of run()'s main
+	// loop, rather than done inline in emit()/errorf(), so a token isn't
+	// handed to a receiver until rtrimLastHTML() can no longer rewrite it.
+	out  chan<- *Token
+	sent int
+
 	startline int
 	startcol  int
 	line      int
 	col       int
+
+	// quote records which quote character (' or ") opened the string
+	// literal currently being scanned by stateString, so the matching
+	// closing quote must be the same one.
+	quote rune
+}
+
+// ensureUpto pulls more runes from l.reader, appending their UTF-8 bytes to
+// l.input, until l.input has at least `end` bytes or the reader reports
+// EOF/an error. It's a no-op when the lexer is driven by a plain string
+// (l.reader == nil).
+func (l *lexer) ensureUpto(end int) {
+	if l.reader == nil {
+		return
+	}
+	for !l.readEOF && len(l.input) < end {
+		r, _, err := l.reader.ReadRune()
+		if err != nil {
+			l.readEOF = true
+			break
+		}
+		l.input += string(r)
+	}
+}
+
+// hasPrefixAt reports whether l.input[idx:] starts with s, pulling in
+// whatever extra input is needed to answer that (for a reader-backed
+// lexer) first.
+func (l *lexer) hasPrefixAt(idx int, s string) bool {
+	l.ensureUpto(idx + len(s))
+	return strings.HasPrefix(l.input[idx:], s)
+}
+
+// flush forwards any tokens appended to l.tokens since the last flush to
+// l.out. A no-op unless the lexer was created by LexReader.
+func (l *lexer) flush() {
+	if l.out == nil {
+		return
+	}
+	for ; l.sent < len(l.tokens); l.sent++ {
+		l.out <- l.tokens[l.sent]
+	}
 }
 
 func (t *Token) String() string {
@@ -88,10 +269,31 @@ func (t *Token) String() string {
 	return fmt.Sprintf("<Token typ=%s (%d) val='%s'>", typ, t.Typ, val)
 }
 
-func lex(name string, input string) ([]*Token, error) {
+// resolveDelimiters applies DefaultDelimiters where opts doesn't configure
+// its own and validates the result.
+func resolveDelimiters(opts *Options) (Delimiters, error) {
+	delims := DefaultDelimiters
+	if opts != nil && !opts.Delimiters.isZero() {
+		delims = opts.Delimiters
+	}
+	if err := delims.validate(); err != nil {
+		return Delimiters{}, err
+	}
+	return delims, nil
+}
+
+func lex(name string, input string, opts *Options) ([]*Token, error) {
+	delims, err := resolveDelimiters(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	l := &lexer{
 		name:      name,
 		input:     input,
+		opts:      opts,
+		delims:    delims,
+		symbols:   buildTokenSymbols(delims),
 		tokens:    make([]*Token, 0, 100),
 		line:      1,
 		col:       1,
@@ -101,22 +303,120 @@ func lex(name string, input string) ([]*Token, error) {
 	l.run()
 	if l.errored {
 		errtoken := l.tokens[len(l.tokens)-1]
-		return nil, errors.New(fmt.Sprintf("[Lexer Error in %s (Line %d Col %d)]: %s",
-			name, errtoken.Line, errtoken.Col, errtoken.Val))
+		return nil, &Error{
+			Sender: "lexer",
+			Location: Location{
+				Filename: name,
+				Line:     errtoken.Line,
+				Column:   errtoken.Col,
+				Offset:   errtoken.Offset,
+			},
+			Token:  errtoken,
+			Msg:    errtoken.Val,
+			source: input,
+		}
 	}
 	return l.tokens, nil
 }
 
+// LexReader lexes a template from an io.RuneReader instead of a fully
+// materialized string, pulling more input only as the lexer's lookahead
+// actually needs it (see hasPrefixAt/ensureUpto). That lets a template
+// streamed from an http.Response.Body or other pipe start lexing - and
+// fail fast on a syntax error - before the whole body has arrived, instead
+// of buffering it all up front just to call lex().
+//
+// Tokens are delivered on the returned channel as they're produced, and
+// the channel is closed once lexing finishes. A lexer error surfaces as a
+// final token with Typ == TokenError rather than through the error result
+// (lex() instead returns no tokens and an *Error), since some tokens may
+// already have been sent down the channel by the time an error is known.
+// The error result only reports invalid Options.Delimiters.
+func LexReader(name string, r io.RuneReader, opts *Options) (<-chan *Token, error) {
+	delims, err := resolveDelimiters(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *Token)
+	l := &lexer{
+		name:      name,
+		reader:    r,
+		out:       ch,
+		opts:      opts,
+		delims:    delims,
+		symbols:   buildTokenSymbols(delims),
+		tokens:    make([]*Token, 0, 100),
+		line:      1,
+		col:       1,
+		startline: 1,
+		startcol:  1,
+	}
+
+	go func() {
+		defer close(ch)
+		l.run()
+	}()
+	return ch, nil
+}
+
+// ToSlice drains a LexReader channel into a slice, for callers that want
+// lex()'s all-at-once []*Token shape rather than incremental delivery. A
+// trailing TokenError is turned into an *Error, same as lex() returns on
+// failure; since the channel carries only tokens, the resulting Error has
+// no Filename or source excerpt available to it.
+func ToSlice(ch <-chan *Token) ([]*Token, error) {
+	tokens := make([]*Token, 0, 100)
+	for tok := range ch {
+		tokens = append(tokens, tok)
+	}
+	if n := len(tokens); n > 0 && tokens[n-1].Typ == TokenError {
+		errtoken := tokens[n-1]
+		return nil, &Error{
+			Sender: "lexer",
+			Location: Location{
+				Line:   errtoken.Line,
+				Column: errtoken.Col,
+				Offset: errtoken.Offset,
+			},
+			Token: errtoken,
+			Msg:   errtoken.Val,
+		}
+	}
+	return tokens, nil
+}
+
 func (l *lexer) value() string {
 	return l.input[l.start:l.pos]
 }
 
 func (l *lexer) emit(t TokenType) {
+	val := l.value()
+	tok := &Token{
+		Typ:    t,
+		Val:    val,
+		Raw:    val,
+		Line:   l.startline,
+		Col:    l.startcol,
+		Offset: l.start,
+	}
+	l.tokens = append(l.tokens, tok)
+	l.start = l.pos
+	l.startline = l.line
+	l.startcol = l.col
+}
+
+// emitString is emit(TokenString), except Val and Raw are supplied
+// separately: stateString decodes escape sequences into Val, while Raw
+// keeps the literal source text (escapes and all) for error messages.
+func (l *lexer) emitString(raw, decoded string) {
 	tok := &Token{
-		Typ:  t,
-		Val:  l.value(),
-		Line: l.startline,
-		Col:  l.startcol,
+		Typ:    TokenString,
+		Val:    decoded,
+		Raw:    raw,
+		Line:   l.startline,
+		Col:    l.startcol,
+		Offset: l.start,
 	}
 	l.tokens = append(l.tokens, tok)
 	l.start = l.pos
@@ -125,6 +425,7 @@ func (l *lexer) emit(t TokenType) {
 }
 
 func (l *lexer) next() rune {
+	l.ensureUpto(l.pos + utf8.UTFMax)
 	if l.pos >= len(l.input) {
 		l.width = 0
 		return EOF
@@ -145,8 +446,16 @@ func (l *lexer) peek() rune {
 	return r
 }
 
+// ignore discards everything scanned since the last token (whitespace, a
+// comment, trimmed whitespace-control whitespace, ...) without emitting a
+// token for it. It syncs startline/startcol to the current line/col the
+// same way emit()/emitString() do, so the next token emitted reports its
+// own start position rather than whatever position line/col were at
+// before the discarded text was scanned.
 func (l *lexer) ignore() {
 	l.start = l.pos
+	l.startline = l.line
+	l.startcol = l.col
 }
 
 func (l *lexer) accept(what string) bool {
@@ -165,10 +474,11 @@ func (l *lexer) acceptRun(what string) {
 
 func (l *lexer) errorf(format string, args ...interface{}) lexerStateFn {
 	t := &Token{
-		Typ:  TokenError,
-		Val:  fmt.Sprintf(format, args...),
-		Line: l.startline,
-		Col:  l.startcol,
+		Typ:    TokenError,
+		Val:    fmt.Sprintf(format, args...),
+		Line:   l.startline,
+		Col:    l.startcol,
+		Offset: l.start,
 	}
 	l.tokens = append(l.tokens, t)
 	l.errored = true
@@ -182,16 +492,33 @@ func (l *lexer) eof() bool {
 }
 
 func (l *lexer) run() {
+	defer l.flush() // guarantee a final flush on every return path, including errors
+
 	for {
-		// Ignore single-line comments {# ... #}
-		if strings.HasPrefix(l.input[l.pos:], "{#") {
+		l.flush() // tokens from the previous iteration are now finalized
+
+		// Ignore single-line comments {# ... #}, with optional {#- -#}
+		// whitespace-trimming markers.
+		commentStart := l.delims.CommentStart
+		trimCommentOpen := false
+		if l.hasPrefixAt(l.pos, l.delims.CommentStart+"-") {
+			commentStart = l.delims.CommentStart + "-"
+			trimCommentOpen = true
+		}
+		if l.hasPrefixAt(l.pos, commentStart) {
 			if l.pos > l.start {
 				l.emit(TokenHTML)
+				if trimCommentOpen {
+					l.rtrimLastHTML()
+				}
 			}
 
-			l.pos += 2 // pass '{#'
-			l.col += 2
+			l.pos += len(commentStart)
+			l.col += len(commentStart)
 
+			commentEnd := l.delims.CommentEnd
+			hyphenCommentEnd := "-" + l.delims.CommentEnd
+			trimCommentClose := false
 			for {
 				switch l.peek() {
 				case EOF:
@@ -202,9 +529,15 @@ func (l *lexer) run() {
 					return
 				}
 
-				if strings.HasPrefix(l.input[l.pos:], "#}") {
-					l.pos += 2 // pass '#}'
-					l.col += 2
+				if l.hasPrefixAt(l.pos, hyphenCommentEnd) {
+					l.pos += len(hyphenCommentEnd)
+					l.col += len(hyphenCommentEnd)
+					trimCommentClose = true
+					break
+				}
+				if l.hasPrefixAt(l.pos, commentEnd) {
+					l.pos += len(commentEnd)
+					l.col += len(commentEnd)
 					break
 				}
 				l.pos++
@@ -212,14 +545,29 @@ func (l *lexer) run() {
 			}
 			l.ignore() // ignore whole comment
 
+			if trimCommentClose {
+				l.trimLeadingWhitespace()
+			}
+
 			// Comment skipped
 			continue // next token
 		}
 
-		if strings.HasPrefix(l.input[l.pos:], "{{") || // variable
-			strings.HasPrefix(l.input[l.pos:], "{%") { // tag
+		isVarTag := l.hasPrefixAt(l.pos, l.delims.VariableStart)
+		isBlockTag := l.hasPrefixAt(l.pos, l.delims.BlockStart)
+		if isVarTag || isBlockTag {
+			hyphenOpen := l.hasPrefixAt(l.pos, l.delims.VariableStart+"-") ||
+				l.hasPrefixAt(l.pos, l.delims.BlockStart+"-")
 			if l.pos > l.start {
 				l.emit(TokenHTML)
+				switch {
+				case hyphenOpen:
+					l.rtrimLastHTML()
+				case isBlockTag && l.opts != nil && l.opts.LStripBlocks && l.pendingHTMLIsLineWhitespaceOnly():
+					// Only the line's own spaces/tabs go; earlier newlines stay.
+					last := l.tokens[len(l.tokens)-1]
+					last.Val = strings.TrimRight(last.Val, " \t")
+				}
 			}
 			l.tokenize()
 			if l.errored {
@@ -244,6 +592,62 @@ func (l *lexer) run() {
 	}
 }
 
+// rtrimLastHTML trims trailing whitespace from the most recently emitted
+// TokenHTML, if any. Used for the explicit `{%-`/`{{-`/`{#-` opening
+// markers.
+func (l *lexer) rtrimLastHTML() {
+	if n := len(l.tokens); n > 0 && l.tokens[n-1].Typ == TokenHTML {
+		l.tokens[n-1].Val = strings.TrimRight(l.tokens[n-1].Val, tokenSpaceChars)
+	}
+}
+
+// pendingHTMLIsLineWhitespaceOnly reports whether the most recently emitted
+// TokenHTML ends with a run of spaces/tabs that is the entirety of its
+// line, i.e. whether a block tag opening right after it is the only
+// non-whitespace thing on that line so far.
+func (l *lexer) pendingHTMLIsLineWhitespaceOnly() bool {
+	n := len(l.tokens)
+	if n == 0 || l.tokens[n-1].Typ != TokenHTML {
+		return false
+	}
+	val := l.tokens[n-1].Val
+	if idx := strings.LastIndexByte(val, '\n'); idx >= 0 {
+		val = val[idx+1:]
+	}
+	return strings.TrimLeft(val, " \t") == ""
+}
+
+// trimLeadingWhitespace consumes and discards a run of whitespace starting
+// at the lexer's current position (used after a `-%}`/`-}}`/`-#}` closing
+// marker), keeping line/col tracking accurate for the following token.
+func (l *lexer) trimLeadingWhitespace() {
+	for {
+		r := l.peek()
+		if strings.IndexRune(tokenSpaceChars, r) < 0 {
+			break
+		}
+		l.next()
+		if r == '\n' {
+			l.line++
+			l.col = 1
+		} else {
+			l.col++
+		}
+	}
+	l.ignore()
+}
+
+// trimOneNewlineAfterBlock consumes a single trailing newline right after a
+// block tag's closing %}, mirroring Jinja2's TrimBlocks option.
+func (l *lexer) trimOneNewlineAfterBlock() {
+	if l.peek() == '\n' {
+		l.next()
+		l.line++
+		l.col = 1
+		l.ignore()
+	}
+}
+
 func (l *lexer) tokenize() {
 	for state := l.stateCode; state != nil; {
 		state = state()
@@ -268,17 +672,32 @@ outer_loop:
 		case l.accept(tokenDigits):
 			return l.stateNumber
 		case l.accept(`"`):
+			l.quote = '"'
+			return l.stateString
+		case l.accept(`'`):
+			l.quote = '\''
 			return l.stateString
 		}
 
 		// Check for symbol
-		for _, sym := range tokenSymbols {
-			if strings.HasPrefix(l.input[l.start:], sym) {
+		hyphenBlockEnd := "-" + l.delims.BlockEnd
+		hyphenVarEnd := "-" + l.delims.VariableEnd
+		for _, sym := range l.symbols {
+			if l.hasPrefixAt(l.start, sym) {
 				l.pos += len(sym)
 				l.col += len(sym)
 				l.emit(TokenSymbol)
 
-				if sym == "%}" || sym == "}}" {
+				switch {
+				case sym == hyphenBlockEnd || sym == hyphenVarEnd:
+					l.trimLeadingWhitespace()
+				case sym == l.delims.BlockEnd:
+					if l.opts != nil && l.opts.TrimBlocks {
+						l.trimOneNewlineAfterBlock()
+					}
+				}
+
+				if sym == l.delims.BlockEnd || sym == l.delims.VariableEnd || sym == hyphenBlockEnd || sym == hyphenVarEnd {
 					// Tag/variable end, return after emit
 					return nil
 				}
@@ -287,6 +706,7 @@ outer_loop:
 			}
 		}
 
+		l.ensureUpto(l.pos + 1)
 		if l.pos < len(l.input) {
 			return l.errorf("Unknown character: %q (%d)", l.peek(), l.peek())
 		}
@@ -314,36 +734,133 @@ func (l *lexer) stateIdentifier() lexerStateFn {
 
 func (l *lexer) stateNumber() lexerStateFn {
 	l.acceptRun(tokenDigits)
-	/*
-		Maybe context-sensitive number lexing?
-		* comments.0.Text // first comment
-		* usercomments.1.0 // second user, first comment
-		* if (score >= 8.5) // 8.5 as a number
-
-		if l.peek() == '.' {
-			l.accept(".")
-			if !l.accept(tokenDigits) {
-				return l.errorf("Malformed number.")
-			}
+
+	// A '.' is only consumed as part of the number when it's followed by
+	// another digit; otherwise it's punctuation and must be left alone so
+	// `comments.0.Text` still lexes as identifier/symbol/number/symbol/identifier.
+	dotPos := l.pos
+	if l.accept(".") {
+		if l.accept(tokenDigits) {
+			l.acceptRun(tokenDigits)
+		} else {
+			l.pos = dotPos
+		}
+	}
+
+	// Scientific notation: 1e10, 2.5e-3, 1E+5.
+	ePos := l.pos
+	if l.accept("eE") {
+		l.accept("+-")
+		if l.accept(tokenDigits) {
 			l.acceptRun(tokenDigits)
+		} else {
+			l.pos = ePos
 		}
-	*/
+	}
+
+	// Negative literals (`-5`) are deliberately NOT folded in here: the '-'
+	// is still emitted as its own TokenSymbol so the parser can tell unary
+	// minus apart from subtraction (`score - 5`); it's the parser's job to
+	// combine TokenSymbol("-") + TokenNumber into a negative literal where
+	// the grammar allows it.
 	l.col += len(l.value())
 	l.emit(TokenNumber)
 	return l.stateCode
 }
 
 func (l *lexer) stateString() lexerStateFn {
-	l.ignore()
-	for !l.accept(`"`) {
-		if l.next() == EOF {
+	quote := l.quote
+	l.ignore() // opening quote was already consumed by stateCode; drop it from the pending value
+
+	var decoded strings.Builder
+scan:
+	for {
+		r := l.next()
+		switch r {
+		case EOF:
 			return l.errorf("Unexpected EOF, string not closed.")
+		case '\n':
+			return l.errorf("Newline not permitted in a string literal.")
+		case quote:
+			break scan
+		case '\\':
+			if msg := l.readStringEscape(&decoded); msg != "" {
+				return l.errorf("%s", msg)
+			}
+		default:
+			decoded.WriteRune(r)
 		}
 	}
-	l.backup()
-	l.col += len(l.value())
-	l.emit(TokenString)
+
+	l.backup() // put the closing quote back, so value()/Raw exclude it just like the opening one
+	raw := l.value()
+	l.col += len(raw) + 2 // both quote characters count toward the source column
+	l.emitString(raw, decoded.String())
 	l.next()
-	l.ignore()
+	l.ignore() // consume and drop the closing quote
 	return l.stateCode
 }
+
+// readStringEscape decodes the escape sequence following a backslash
+// already consumed by stateString, writing its decoded form to decoded.
+// Supports \n, \t, \r, \\, \", \', \xHH and \uHHHH. Returns a non-empty
+// message describing the problem if the sequence is malformed.
+func (l *lexer) readStringEscape(decoded *strings.Builder) string {
+	switch r := l.next(); r {
+	case EOF:
+		return "Unexpected EOF, string not closed."
+	case 'n':
+		decoded.WriteByte('\n')
+	case 't':
+		decoded.WriteByte('\t')
+	case 'r':
+		decoded.WriteByte('\r')
+	case '\\':
+		decoded.WriteByte('\\')
+	case '"':
+		decoded.WriteByte('"')
+	case '\'':
+		decoded.WriteByte('\'')
+	case 'x':
+		v, msg := l.readHexDigits(2)
+		if msg != "" {
+			return msg
+		}
+		decoded.WriteByte(byte(v))
+	case 'u':
+		v, msg := l.readHexDigits(4)
+		if msg != "" {
+			return msg
+		}
+		decoded.WriteRune(rune(v))
+	default:
+		return fmt.Sprintf("Unknown escape sequence '\\%c' in string literal.", r)
+	}
+	return ""
+}
+
+// readHexDigits consumes exactly n hex digits and returns their value.
+func (l *lexer) readHexDigits(n int) (int, string) {
+	val := 0
+	for i := 0; i < n; i++ {
+		d := hexDigitValue(l.next())
+		if d < 0 {
+			return 0, fmt.Sprintf("Invalid escape sequence: expected %d hex digits.", n)
+		}
+		val = val*16 + d
+	}
+	return val, ""
+}
+
+func hexDigitValue(r rune) int {
+	switch {
+	case r >= '0' && r <= '9':
+		return int(r - '0')
+	case r >= 'a' && r <= 'f':
+		return int(r-'a') + 10
+	case r >= 'A' && r <= 'F':
+		return int(r-'A') + 10
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,349 @@
+package pongo2
+
+import (
+	"strings"
+	"testing"
+)
+
+// findToken returns the single token of typ in tokens, failing the test if
+// there isn't exactly one.
+func findToken(t *testing.T, tokens []*Token, typ TokenType) *Token {
+	t.Helper()
+	var found *Token
+	for _, tok := range tokens {
+		if tok.Typ == typ {
+			if found != nil {
+				t.Fatalf("expected exactly one token of type %d, found more than one", typ)
+			}
+			found = tok
+		}
+	}
+	if found == nil {
+		t.Fatalf("expected a token of type %d, found none", typ)
+	}
+	return found
+}
+
+// htmlVals returns the Val of every TokenHTML token, in order.
+func htmlVals(tokens []*Token) []string {
+	var vals []string
+	for _, tok := range tokens {
+		if tok.Typ == TokenHTML {
+			vals = append(vals, tok.Val)
+		}
+	}
+	return vals
+}
+
+func assertStrings(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestWhitespaceControlMarkersTrimNestedTags(t *testing.T) {
+	// Mimics a nested-loop-shaped template: each "-" marker strips the
+	// whitespace/newline around it, so the surviving HTML is exactly the
+	// human-readable words with no stray indentation or blank lines.
+	input := "Hello \n{%- if true -%}\n World \n{%- endif -%}\nBye"
+
+	tokens, err := lex("test", input, nil)
+	if err != nil {
+		t.Fatalf("lex() returned error: %v", err)
+	}
+	assertStrings(t, htmlVals(tokens), []string{"Hello", "World", "Bye"})
+}
+
+func TestTrimBlocksStripsNewlineAfterBlockTag(t *testing.T) {
+	input := "{% if true %}\nX"
+
+	withOpt, err := lex("test", input, &Options{TrimBlocks: true})
+	if err != nil {
+		t.Fatalf("lex() returned error: %v", err)
+	}
+	assertStrings(t, htmlVals(withOpt), []string{"X"})
+
+	without, err := lex("test", input, nil)
+	if err != nil {
+		t.Fatalf("lex() returned error: %v", err)
+	}
+	assertStrings(t, htmlVals(without), []string{"\nX"})
+}
+
+func TestLStripBlocksStripsLeadingLineWhitespace(t *testing.T) {
+	input := "   {% if true %}X"
+
+	withOpt, err := lex("test", input, &Options{LStripBlocks: true})
+	if err != nil {
+		t.Fatalf("lex() returned error: %v", err)
+	}
+	assertStrings(t, htmlVals(withOpt), []string{"", "X"})
+
+	without, err := lex("test", input, nil)
+	if err != nil {
+		t.Fatalf("lex() returned error: %v", err)
+	}
+	assertStrings(t, htmlVals(without), []string{"   ", "X"})
+}
+
+func TestStringLiteralQuotesAndEscapes(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   string
+		wantVal string
+		wantRaw string
+	}{
+		{"double quoted", `{{ "hello" }}`, "hello", "hello"},
+		{"single quoted", `{{ 'hello' }}`, "hello", "hello"},
+		{"double-quoted string containing a single quote", `{{ "it's" }}`, "it's", "it's"},
+		{"single-quoted string containing a double quote", `{{ 'say "hi"' }}`, `say "hi"`, `say "hi"`},
+		{"newline/tab/backslash escapes", `{{ "a\nb\tc\\d" }}`, "a\nb\tc\\d", `a\nb\tc\\d`},
+		{"quote escapes", `{{ "a\"b\'c" }}`, `a"b'c`, `a\"b\'c`},
+		{"hex escape", `{{ "\x41\x42" }}`, "AB", `\x41\x42`},
+		{"unicode escape", "{{ \"\\u00e9\" }}", "é", "\\u00e9"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tokens, err := lex("test", c.input, nil)
+			if err != nil {
+				t.Fatalf("lex() returned error: %v", err)
+			}
+			str := findToken(t, tokens, TokenString)
+			if str.Val != c.wantVal {
+				t.Errorf("Val = %q, want %q", str.Val, c.wantVal)
+			}
+			if str.Raw != c.wantRaw {
+				t.Errorf("Raw = %q, want %q", str.Raw, c.wantRaw)
+			}
+		})
+	}
+}
+
+func TestStringLiteralMismatchedQuoteDoesNotClose(t *testing.T) {
+	// A " inside a '...' string (or vice versa) must not terminate it.
+	tokens, err := lex("test", `{{ 'a"b' }}`, nil)
+	if err != nil {
+		t.Fatalf("lex() returned error: %v", err)
+	}
+	str := findToken(t, tokens, TokenString)
+	if str.Val != `a"b` {
+		t.Errorf("Val = %q, want %q", str.Val, `a"b`)
+	}
+}
+
+func TestLexReaderMatchesLex(t *testing.T) {
+	input := "Hello {{ name }}! {% if true %}yes{% endif %}"
+
+	want, err := lex("test", input, nil)
+	if err != nil {
+		t.Fatalf("lex() returned error: %v", err)
+	}
+
+	ch, err := LexReader("test", strings.NewReader(input), nil)
+	if err != nil {
+		t.Fatalf("LexReader() returned error: %v", err)
+	}
+	got, err := ToSlice(ch)
+	if err != nil {
+		t.Fatalf("ToSlice() returned error: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Typ != want[i].Typ || got[i].Val != want[i].Val {
+			t.Errorf("token[%d] = {typ=%d val=%q}, want {typ=%d val=%q}",
+				i, got[i].Typ, got[i].Val, want[i].Typ, want[i].Val)
+		}
+	}
+}
+
+func TestLexReaderSurfacesErrorThroughToSlice(t *testing.T) {
+	ch, err := LexReader("test", strings.NewReader("{{ @ }}"), nil)
+	if err != nil {
+		t.Fatalf("LexReader() returned error: %v", err)
+	}
+	if _, err := ToSlice(ch); err == nil {
+		t.Fatalf("expected ToSlice() to return an error for an unknown character")
+	}
+}
+
+func TestDelimitersCustomSymbolsLex(t *testing.T) {
+	cases := []struct {
+		name   string
+		delims Delimiters
+		input  string
+	}{
+		{
+			name: "double brackets for variables",
+			delims: Delimiters{
+				VariableStart: "[[", VariableEnd: "]]",
+				BlockStart: "{%", BlockEnd: "%}",
+				CommentStart: "{#", CommentEnd: "#}",
+			},
+			input: "Hello [[ name ]]!",
+		},
+		{
+			// The exact example from the request: <% %> shares a prefix
+			// with the existing "<" operator symbol, which used to be
+			// (wrongly) rejected by Delimiters.validate().
+			name: "angle brackets for blocks",
+			delims: Delimiters{
+				VariableStart: "{{", VariableEnd: "}}",
+				BlockStart: "<%", BlockEnd: "%>",
+				CommentStart: "{#", CommentEnd: "#}",
+			},
+			input: "<% if true %>hi<% endif %>",
+		},
+		{
+			name: "parenthesized comment",
+			delims: Delimiters{
+				VariableStart: "{{", VariableEnd: "}}",
+				BlockStart: "{%", BlockEnd: "%}",
+				CommentStart: "(#", CommentEnd: "#)",
+			},
+			input: "before (# a comment #) after",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tokens, err := lex("test", c.input, &Options{Delimiters: c.delims})
+			if err != nil {
+				t.Fatalf("lex() returned error: %v", err)
+			}
+			if len(tokens) == 0 {
+				t.Fatalf("lex() returned no tokens")
+			}
+		})
+	}
+}
+
+func TestNumberLexing(t *testing.T) {
+	cases := []struct {
+		name      string
+		input     string
+		wantTypes []TokenType
+		wantVals  []string
+	}{
+		{
+			name:      "decimal",
+			input:     "{{ 8.5 }}",
+			wantTypes: []TokenType{TokenSymbol, TokenNumber, TokenSymbol},
+			wantVals:  []string{"{{", "8.5", "}}"},
+		},
+		{
+			name:      "scientific notation",
+			input:     "{{ 1e10 }}",
+			wantTypes: []TokenType{TokenSymbol, TokenNumber, TokenSymbol},
+			wantVals:  []string{"{{", "1e10", "}}"},
+		},
+		{
+			name:      "decimal with negative exponent",
+			input:     "{{ 2.5e-3 }}",
+			wantTypes: []TokenType{TokenSymbol, TokenNumber, TokenSymbol},
+			wantVals:  []string{"{{", "2.5e-3", "}}"},
+		},
+		{
+			// The disambiguation case called out in the request: a bare
+			// '.' not followed by a digit must stay a TokenSymbol so
+			// property access still parses.
+			name:  "dotted property access isn't swallowed by a number",
+			input: "{{ comments.0.Text }}",
+			wantTypes: []TokenType{
+				TokenSymbol, TokenIdentifier, TokenSymbol, TokenNumber,
+				TokenSymbol, TokenIdentifier, TokenSymbol,
+			},
+			wantVals: []string{"{{", "comments", ".", "0", ".", "Text", "}}"},
+		},
+		{
+			name:      "greater-or-equal comparison",
+			input:     "{{ a >= b }}",
+			wantTypes: []TokenType{TokenSymbol, TokenIdentifier, TokenSymbol, TokenIdentifier, TokenSymbol},
+			wantVals:  []string{"{{", "a", ">=", "b", "}}"},
+		},
+		{
+			name:      "less-or-equal comparison",
+			input:     "{{ a <= b }}",
+			wantTypes: []TokenType{TokenSymbol, TokenIdentifier, TokenSymbol, TokenIdentifier, TokenSymbol},
+			wantVals:  []string{"{{", "a", "<=", "b", "}}"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tokens, err := lex("test", c.input, nil)
+			if err != nil {
+				t.Fatalf("lex() returned error: %v", err)
+			}
+			if len(tokens) != len(c.wantTypes) {
+				t.Fatalf("got %d tokens, want %d: %v", len(tokens), len(c.wantTypes), tokens)
+			}
+			for i, tok := range tokens {
+				if tok.Typ != c.wantTypes[i] || tok.Val != c.wantVals[i] {
+					t.Errorf("token[%d] = {typ=%d val=%q}, want {typ=%d val=%q}",
+						i, tok.Typ, tok.Val, c.wantTypes[i], c.wantVals[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTokenColAccountsForLeadingIntraTagWhitespace(t *testing.T) {
+	// A regression test for a stale startcol: a token's reported Col used
+	// to stick at the position right before any whitespace that preceded
+	// it inside the tag, rather than its actual start column, because
+	// ignore() (used to drop that whitespace) didn't resync
+	// startcol/startline the way emit() does. Offset (byte-based) was
+	// never affected, only Col.
+	tokens, err := lex("test", "{{   8.5 }}", nil)
+	if err != nil {
+		t.Fatalf("lex() returned error: %v", err)
+	}
+	num := findToken(t, tokens, TokenNumber)
+	if num.Col != 6 {
+		t.Errorf("Col = %d, want 6 (the real column of '8.5', not the column right after '{{')", num.Col)
+	}
+}
+
+func TestTokenColAccountsForWhitespaceStrippedByTrimLeadingWhitespace(t *testing.T) {
+	// Same root cause as the chunk0-2 stale-startcol fix, via
+	// trimLeadingWhitespace specifically: the HTML following a "-}}"
+	// closing marker used to report the column right after the marker,
+	// ignoring the whitespace trimLeadingWhitespace had just consumed and
+	// discarded.
+	tokens, err := lex("test", "{{ a -}}   @", nil)
+	if err != nil {
+		t.Fatalf("lex() returned error: %v", err)
+	}
+	html := findToken(t, tokens, TokenHTML)
+	if html.Val != "@" {
+		t.Fatalf("HTML Val = %q, want %q", html.Val, "@")
+	}
+	if html.Col != 12 {
+		t.Errorf("Col = %d, want 12 (the real column of '@', past the stripped whitespace)", html.Col)
+	}
+}
+
+func TestDelimitersValidateRejectsExactOperatorMatch(t *testing.T) {
+	// BlockStart "-" is exactly the "-" operator symbol: a genuine
+	// ambiguity, unlike a delimiter that merely shares a prefix with a
+	// shorter operator (buildTokenSymbols sorts longest-first, so that
+	// case resolves correctly on its own).
+	delims := Delimiters{
+		VariableStart: "{{", VariableEnd: "}}",
+		BlockStart: "-", BlockEnd: "%}",
+		CommentStart: "{#", CommentEnd: "#}",
+	}
+	if err := delims.validate(); err == nil {
+		t.Fatalf("expected validate() to reject a delimiter equal to an operator symbol")
+	}
+}